@@ -1,12 +1,16 @@
 package ipxe
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
 	"fmt"
 	"net"
 	"net/http"
 	"net/url"
 	"path"
+	"strings"
+	"text/template"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
@@ -18,6 +22,10 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
+// uefiHTTPBootUserAgentPrefix is the User-Agent string UEFI HTTP Boot clients present
+// when fetching their boot script directly, e.g. "UefiHttpBoot/1.0".
+const uefiHTTPBootUserAgentPrefix = "UefiHttpBoot/"
+
 type Handler struct {
 	Logger             logr.Logger
 	Finder             client.HardwareFinder
@@ -26,11 +34,70 @@ type Handler struct {
 	PublicSyslogFQDN   string
 	TinkServerTLS      bool
 	TinkServerGRPCAddr string
+	// TinkServerInsecureTLS, when set alongside TinkServerTLS, tells the Tink worker to
+	// skip certificate verification when talking to the Tink server. This is for
+	// bring-up against Tink servers using self-signed or otherwise untrusted certs.
+	TinkServerInsecureTLS bool
+	// HTTPBootPaths are additional URL basenames, beyond "auto.ipxe", that this handler
+	// will serve. They exist so a UEFI HTTP Boot client can be pointed at a path of the
+	// operator's choosing (e.g. "boot.ipxe") without colliding with the iPXE chainload flow.
+	// On these paths a script is rendered only for UEFI HTTP Boot clients (by User-Agent)
+	// or for machines with a custom script; any other request gets a 404.
+	HTTPBootPaths []string
+	// DisableCustomScriptTemplating preserves the legacy behavior of serving
+	// hw.Hardware().IPXEScript(mac) verbatim instead of treating it as a text/template.
+	DisableCustomScriptTemplating bool
+	// TrustedSigningCertURL, when set, is used to verify the signature of a chained
+	// custom iPXE script (hw.Hardware().IPXEURL(mac)) before it is chained to.
+	TrustedSigningCertURL string
+	// RequireSignedChain, when true, refuses to render a custom chain script unless
+	// TrustedSigningCertURL is configured.
+	RequireSignedChain bool
+	// Providers are the available ScriptProvider backends, tried in the order described
+	// by scriptProvider. If empty, the built-in HookOS behavior is used for every
+	// machine, preserving today's behavior.
+	Providers []ScriptProvider
+	// DefaultProviderKind is the Provider.Name() used for a machine when
+	// hw.Hardware().OSIEKind(mac) is empty or does not match any configured Provider.
+	DefaultProviderKind string
+}
+
+// serverHostContextKey is an unexported context key used to carry the HTTP request's
+// Host header down to ScriptProvider.Custom, whose signature (per the ScriptProvider
+// interface) only takes a context, hardware record, and client IP.
+type serverHostContextKey struct{}
+
+func contextWithServerHost(ctx context.Context, host string) context.Context {
+	return context.WithValue(ctx, serverHostContextKey{}, host)
+}
+
+func serverHostFromContext(ctx context.Context) string {
+	host, _ := ctx.Value(serverHostContextKey{}).(string)
+
+	return host
+}
+
+// isUEFIHTTPBootClient reports whether r was made by a UEFI HTTP Boot client, which
+// fetches its boot script directly rather than chainloading iPXE first.
+func isUEFIHTTPBootClient(r *http.Request) bool {
+	return strings.HasPrefix(r.UserAgent(), uefiHTTPBootUserAgentPrefix)
+}
+
+// isHTTPBootPath reports whether name matches one of the configured HTTPBootPaths.
+func (h *Handler) isHTTPBootPath(name string) bool {
+	for _, p := range h.HTTPBootPaths {
+		if path.Base(p) == name {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (h *Handler) HandlerFunc() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if path.Base(r.URL.Path) != "auto.ipxe" {
+		name := path.Base(r.URL.Path)
+		if name != "auto.ipxe" && !h.isHTTPBootPath(name) {
 			h.Logger.Info("not found", "path", r.URL.Path)
 			w.WriteHeader(http.StatusNotFound)
 
@@ -51,7 +118,7 @@ func (h *Handler) HandlerFunc() http.HandlerFunc {
 			return
 		}
 		ip := net.ParseIP(host)
-		ctx := r.Context()
+		ctx := contextWithServerHost(r.Context(), r.Host)
 		// get hardware record
 		hw, err := h.Finder.ByIP(ctx, ip)
 		if err != nil {
@@ -73,7 +140,7 @@ func (h *Handler) HandlerFunc() http.HandlerFunc {
 			return
 		}
 
-		h.serveBootScript(ctx, w, path.Base(r.URL.Path), ip.String(), hw)
+		h.serveBootScript(ctx, w, name, ip.String(), hw, isUEFIHTTPBootClient(r))
 	}
 }
 
@@ -86,17 +153,48 @@ func customScriptFound(hw client.Discoverer, ip string) bool {
 	return hw.Hardware().IPXEURL(mac) != "" || hw.Hardware().IPXEScript(mac) != ""
 }
 
-func (h *Handler) serveBootScript(ctx context.Context, w http.ResponseWriter, name string, ip string, hw client.Discoverer) {
+func (h *Handler) serveBootScript(ctx context.Context, w http.ResponseWriter, name string, ip string, hw client.Discoverer, httpBoot bool) {
 	span := trace.SpanFromContext(ctx)
-	span.SetAttributes(attribute.String("boots.script_name", name))
+	span.SetAttributes(attribute.String("boots.script_name", name), attribute.Bool("boots.http_boot", httpBoot))
 	var script []byte
+	// UEFI HTTP Boot clients fetch this path directly, without an iPXE shim in front of
+	// them, so they get a script rendered from a template that omits iPXE-only commands.
+	if httpBoot {
+		if customScriptFound(hw, ip) {
+			h.Logger.Info("ignoring custom ipxe chain/script for a UEFI HTTP Boot client; custom scripts are not supported for this client class", "client", ip)
+		}
+		mac := hw.GetMAC(net.ParseIP(ip))
+		provider := h.scriptProvider(hw, mac)
+		span.SetAttributes(attribute.String("boots.script_provider", provider.Name()))
+		s, err := provider.HTTPBoot(ctx, hw, ip)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			err := errors.Wrap(err, "error with HTTP Boot script")
+			h.Logger.Error(err, "error", "script", name)
+			span.SetStatus(codes.Error, err.Error())
+
+			return
+		}
+		script = s
+		span.SetAttributes(attribute.String("ipxe-script", string(script)))
+
+		if _, err := w.Write(script); err != nil {
+			h.Logger.Error(errors.Wrap(err, "unable to write boot script"), "unable to write boot script", "script", name)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		return
+	}
 	// check if the custom script should be used
 	if customScriptFound(hw, ip) {
 		name = "custom.ipxe"
 	}
+	mac := hw.GetMAC(net.ParseIP(ip))
+	provider := h.scriptProvider(hw, mac)
+	span.SetAttributes(attribute.String("boots.script_provider", provider.Name()))
 	switch name {
 	case "auto.ipxe":
-		s, err := h.defaultScript(span, hw, ip)
+		s, err := provider.Default(ctx, hw, ip)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			err := errors.Wrap(err, "error with default ipxe script")
@@ -105,9 +203,9 @@ func (h *Handler) serveBootScript(ctx context.Context, w http.ResponseWriter, na
 
 			return
 		}
-		script = []byte(s)
+		script = s
 	case "custom.ipxe":
-		cs, err := h.customScript(hw, ip)
+		cs, err := provider.Custom(ctx, hw, ip)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			err := errors.Wrap(err, "error with custom ipxe script")
@@ -116,7 +214,7 @@ func (h *Handler) serveBootScript(ctx context.Context, w http.ResponseWriter, na
 
 			return
 		}
-		script = []byte(cs)
+		script = cs
 	default:
 		w.WriteHeader(http.StatusNotFound)
 		err := errors.Errorf("boot script %q not found", name)
@@ -147,17 +245,18 @@ func (h *Handler) defaultScript(span trace.Span, hw client.Discoverer, ip string
 	}
 
 	auto := Hook{
-		Arch:              arch,
-		Console:           "",
-		DownloadURL:       h.OSIEURL,
-		ExtraKernelParams: h.ExtraKernelParams,
-		Facility:          hw.Hardware().HardwareFacilityCode(),
-		HWAddr:            mac.String(),
-		SyslogHost:        h.PublicSyslogFQDN,
-		TinkerbellTLS:     h.TinkServerTLS,
-		TinkGRPCAuthority: h.TinkServerGRPCAddr,
-		VLANID:            hw.Hardware().GetVLANID(mac),
-		WorkerID:          wID,
+		Arch:                  arch,
+		Console:               "",
+		DownloadURL:           h.OSIEURL,
+		ExtraKernelParams:     h.ExtraKernelParams,
+		Facility:              hw.Hardware().HardwareFacilityCode(),
+		HWAddr:                mac.String(),
+		SyslogHost:            h.PublicSyslogFQDN,
+		TinkerbellTLS:         h.TinkServerTLS,
+		TinkerbellInsecureTLS: h.TinkServerTLS && h.TinkServerInsecureTLS,
+		TinkGRPCAuthority:     h.TinkServerGRPCAddr,
+		VLANID:                hw.Hardware().GetVLANID(mac),
+		WorkerID:              wID,
 	}
 	if sc := span.SpanContext(); sc.IsSampled() {
 		auto.TraceID = sc.TraceID().String()
@@ -166,8 +265,46 @@ func (h *Handler) defaultScript(span trace.Span, hw client.Discoverer, ip string
 	return GenerateTemplate(auto, HookScript)
 }
 
+// defaultScriptHTTPBoot renders the boot configuration for UEFI HTTP Boot clients. These
+// clients fetch this script directly over HTTP rather than chainloading into iPXE first,
+// so the rendered output omits the iPXE-only directives of HookScript (the "#!ipxe"
+// shebang, "set", "kernel", "boot") and instead emits the kernel/initrd/cmdline
+// configuration directly as "linux" and "initrd" lines. Arch is
+// taken from the DHCP client architecture info on the hardware record (x86_64 for UEFI
+// HTTP Boot arch 16, arm64 for arch 19, etc.), same as the iPXE chainload path.
+func (h *Handler) defaultScriptHTTPBoot(span trace.Span, hw client.Discoverer, ip string) (string, error) {
+	mac := hw.GetMAC(net.ParseIP(ip))
+	arch := hw.Hardware().HardwareArch(mac)
+	if arch == "" {
+		arch = "x86_64"
+	}
+	wID := mac.String()
+	if hw.Instance() != nil && hw.Instance().ID != "" {
+		wID = hw.Instance().ID
+	}
+
+	auto := Hook{
+		Arch:                  arch,
+		DownloadURL:           h.OSIEURL,
+		ExtraKernelParams:     h.ExtraKernelParams,
+		Facility:              hw.Hardware().HardwareFacilityCode(),
+		HWAddr:                mac.String(),
+		SyslogHost:            h.PublicSyslogFQDN,
+		TinkerbellTLS:         h.TinkServerTLS,
+		TinkerbellInsecureTLS: h.TinkServerTLS && h.TinkServerInsecureTLS,
+		TinkGRPCAuthority:     h.TinkServerGRPCAddr,
+		VLANID:                hw.Hardware().GetVLANID(mac),
+		WorkerID:              wID,
+	}
+	if sc := span.SpanContext(); sc.IsSampled() {
+		auto.TraceID = sc.TraceID().String()
+	}
+
+	return GenerateTemplate(auto, HookScriptHTTPBoot)
+}
+
 // customScript returns the custom script or chain URL if defined in the hardware data otherwise an error.
-func (h *Handler) customScript(hw client.Discoverer, ip string) (string, error) {
+func (h *Handler) customScript(ctx context.Context, hw client.Discoverer, ip string) (string, error) {
 	mac := hw.GetMAC(net.ParseIP(ip))
 	if chain := hw.Hardware().IPXEURL(mac); chain != "" {
 		u, err := url.Parse(chain)
@@ -178,12 +315,210 @@ func (h *Handler) customScript(hw client.Discoverer, ip string) (string, error)
 			return "", fmt.Errorf("invalid URL scheme: %v", u.Scheme)
 		}
 		c := Custom{Chain: u}
+		if h.RequireSignedChain || h.TrustedSigningCertURL != "" {
+			if h.TrustedSigningCertURL == "" {
+				return "", errors.New("signed chain required but no trusted signing cert URL configured")
+			}
+			certURL, err := url.Parse(h.TrustedSigningCertURL)
+			if err != nil {
+				return "", errors.Wrap(err, "invalid trusted signing cert URL")
+			}
+			c.TrustedSigningCertURL = certURL
+		}
+
 		return GenerateTemplate(c, CustomScript)
 	}
 	if script := hw.Hardware().IPXEScript(mac); script != "" {
+		if !h.DisableCustomScriptTemplating {
+			rendered, err := renderCustomScript(hw, mac, ip, serverHostFromContext(ctx), script)
+			if err != nil {
+				return "", errors.Wrap(err, "error rendering custom ipxe script")
+			}
+			script = rendered
+		}
 		c := Custom{Script: script}
 		return GenerateTemplate(c, CustomScript)
 	}
 
 	return "", errors.New("no custom script or chain defined in the hardware data")
 }
+
+// metadataProvider is implemented by hardware records that expose operator-defined
+// key/value metadata (tags) for use in templated custom scripts via the V function.
+type metadataProvider interface {
+	HardwareMetadata(mac net.HardwareAddr) map[string]string
+}
+
+// customScriptVars is the template context available to a per-MAC custom iPXE script
+// (hw.Hardware().IPXEScript(mac)) when DisableCustomScriptTemplating is false. There is
+// no separate "hardware IP" in this codebase distinct from the request's source
+// address, so ClientIP is the only IP field; don't add a second one that just
+// duplicates it.
+type customScriptVars struct {
+	MAC        string
+	Arch       string
+	Facility   string
+	InstanceID string
+	VLANID     string
+	ClientIP   string
+	ServerHost string
+}
+
+// customScriptFuncMap returns the sandboxed function map available to a per-MAC custom
+// iPXE script template: V for operator-defined metadata lookups, plus small formatters.
+func customScriptFuncMap(hw client.Discoverer, mac net.HardwareAddr) template.FuncMap {
+	return template.FuncMap{
+		"V": func(key string) string {
+			mp, ok := hw.Hardware().(metadataProvider)
+			if !ok {
+				return ""
+			}
+
+			return mp.HardwareMetadata(mac)[key]
+		},
+		"hex": func(s string) string {
+			return hex.EncodeToString([]byte(s))
+		},
+		"default": func(def, val string) string {
+			if val == "" {
+				return def
+			}
+
+			return val
+		},
+		"mac": func(sep string) string {
+			return strings.ReplaceAll(mac.String(), ":", sep)
+		},
+	}
+}
+
+// renderCustomScript treats script as a Go text/template and executes it against the
+// hardware/instance fields for mac plus request-derived values, so a single template
+// stored in hardware data can be rendered per-machine.
+func renderCustomScript(hw client.Discoverer, mac net.HardwareAddr, ip string, serverHost string, script string) (string, error) {
+	wID := mac.String()
+	if hw.Instance() != nil && hw.Instance().ID != "" {
+		wID = hw.Instance().ID
+	}
+
+	vars := customScriptVars{
+		MAC:        mac.String(),
+		Arch:       hw.Hardware().HardwareArch(mac),
+		Facility:   hw.Hardware().HardwareFacilityCode(),
+		InstanceID: wID,
+		VLANID:     hw.Hardware().GetVLANID(mac),
+		ClientIP:   ip,
+		ServerHost: serverHost,
+	}
+
+	t, err := template.New("custom-ipxe-script").Funcs(customScriptFuncMap(hw, mac)).Parse(script)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid custom script template")
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, vars); err != nil {
+		return "", errors.Wrap(err, "executing custom script template")
+	}
+
+	return buf.String(), nil
+}
+
+// ScriptProvider generates the boot scripts served by Handler for "auto.ipxe" and
+// "custom.ipxe" requests. Handler picks a provider per machine (see scriptProvider), so
+// a single boots deployment can serve heterogeneous OS installers.
+type ScriptProvider interface {
+	// Name identifies the provider; it is matched against hw.Hardware().OSIEKind(mac)
+	// and Handler.DefaultProviderKind.
+	Name() string
+	// Default renders the "auto.ipxe" boot script for hw.
+	Default(ctx context.Context, hw client.Discoverer, ip string) ([]byte, error)
+	// Custom renders the "custom.ipxe" (operator-provided chain/script) boot script for hw.
+	Custom(ctx context.Context, hw client.Discoverer, ip string) ([]byte, error)
+	// HTTPBoot renders the boot configuration for a UEFI HTTP Boot client, which fetches
+	// this directly rather than chainloading into iPXE first.
+	HTTPBoot(ctx context.Context, hw client.Discoverer, ip string) ([]byte, error)
+}
+
+// hookOSProviderName is the Name() of the built-in HookOS provider. It is always
+// resolvable by this name, and as the final fallback, regardless of what's in
+// Handler.Providers, so configuring an additional provider (e.g. a CoreOSProvider for
+// an arm64 fleet) can never silently redirect an unrelated or legacy-tagged machine
+// away from HookOS.
+const hookOSProviderName = "hookos"
+
+// scriptProvider selects the ScriptProvider that should serve mac: by
+// hw.Hardware().OSIEKind(mac), falling back to h.DefaultProviderKind, falling back to
+// the built-in HookOS provider.
+func (h *Handler) scriptProvider(hw client.Discoverer, mac net.HardwareAddr) ScriptProvider {
+	if p := h.providerNamed(hw.Hardware().OSIEKind(mac)); p != nil {
+		return p
+	}
+	if p := h.providerNamed(h.DefaultProviderKind); p != nil {
+		return p
+	}
+
+	return NewHookOSProvider(h)
+}
+
+// providerNamed looks up name among h.Providers, with "hookos" always resolving to the
+// built-in HookOS provider even if it's not present in h.Providers. It returns nil, not
+// a default, when name is empty or unmatched, so callers can tell "no match" apart from
+// "matched hookos".
+func (h *Handler) providerNamed(name string) ScriptProvider {
+	if name == "" {
+		return nil
+	}
+	if name == hookOSProviderName {
+		return NewHookOSProvider(h)
+	}
+	for _, p := range h.Providers {
+		if p.Name() == name {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// hookOSProvider adapts Handler's built-in HookOS script rendering to the
+// ScriptProvider interface.
+type hookOSProvider struct {
+	*Handler
+}
+
+// NewHookOSProvider returns the built-in HookOS ScriptProvider, configured from h. It
+// is always resolvable by the name "hookos" (see scriptProvider), but operators can
+// also list it explicitly in Handler.Providers, e.g. to set it as DefaultProviderKind.
+func NewHookOSProvider(h *Handler) ScriptProvider {
+	return &hookOSProvider{h}
+}
+
+func (p *hookOSProvider) Name() string { return hookOSProviderName }
+
+func (p *hookOSProvider) Default(ctx context.Context, hw client.Discoverer, ip string) ([]byte, error) {
+	s, err := p.defaultScript(trace.SpanFromContext(ctx), hw, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(s), nil
+}
+
+func (p *hookOSProvider) Custom(ctx context.Context, hw client.Discoverer, ip string) ([]byte, error) {
+	s, err := p.customScript(ctx, hw, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(s), nil
+}
+
+func (p *hookOSProvider) HTTPBoot(ctx context.Context, hw client.Discoverer, ip string) ([]byte, error) {
+	s, err := p.defaultScriptHTTPBoot(trace.SpanFromContext(ctx), hw, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(s), nil
+}
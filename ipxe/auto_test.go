@@ -0,0 +1,250 @@
+package ipxe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/tinkerbell/boots/client"
+)
+
+// fakeHardware is a minimal client.Hardware for exercising Handler/ScriptProvider logic
+// without a real hardware data source.
+type fakeHardware struct {
+	arch       string
+	facility   string
+	ipxeURL    string
+	ipxeScript string
+	vlanID     string
+	osieKind   string
+	metadata   map[string]string
+}
+
+func (f *fakeHardware) HardwareAllowPXE(net.HardwareAddr) bool { return true }
+func (f *fakeHardware) HardwareArch(net.HardwareAddr) string   { return f.arch }
+func (f *fakeHardware) HardwareFacilityCode() string           { return f.facility }
+func (f *fakeHardware) GetVLANID(net.HardwareAddr) string      { return f.vlanID }
+func (f *fakeHardware) IPXEURL(net.HardwareAddr) string        { return f.ipxeURL }
+func (f *fakeHardware) IPXEScript(net.HardwareAddr) string     { return f.ipxeScript }
+func (f *fakeHardware) OSIEKind(net.HardwareAddr) string       { return f.osieKind }
+
+func (f *fakeHardware) HardwareMetadata(net.HardwareAddr) map[string]string { return f.metadata }
+
+// fakeDiscoverer is a minimal client.Discoverer backed by a fakeHardware.
+type fakeDiscoverer struct {
+	mac      net.HardwareAddr
+	hardware *fakeHardware
+	instance *client.Instance
+}
+
+func (f *fakeDiscoverer) Hardware() client.Hardware      { return f.hardware }
+func (f *fakeDiscoverer) Instance() *client.Instance     { return f.instance }
+func (f *fakeDiscoverer) GetMAC(net.IP) net.HardwareAddr { return f.mac }
+
+// fakeProvider is a ScriptProvider whose Name() is all that matters for the selection
+// tests in this file; its render methods are never expected to be called.
+type fakeProvider struct {
+	name string
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+
+func (p *fakeProvider) Default(context.Context, client.Discoverer, string) ([]byte, error) {
+	return nil, errors.New("fakeProvider.Default should not be called by these tests")
+}
+
+func (p *fakeProvider) Custom(context.Context, client.Discoverer, string) ([]byte, error) {
+	return nil, errors.New("fakeProvider.Custom should not be called by these tests")
+}
+
+func (p *fakeProvider) HTTPBoot(context.Context, client.Discoverer, string) ([]byte, error) {
+	return nil, errors.New("fakeProvider.HTTPBoot should not be called by these tests")
+}
+
+func mustParseMAC(t *testing.T, s string) net.HardwareAddr {
+	t.Helper()
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		t.Fatalf("parsing test MAC %q: %v", s, err)
+	}
+
+	return mac
+}
+
+// TestScriptProviderFallback guards against configuring an additional provider (e.g. a
+// CoreOSProvider for an arm64 fleet) silently redirecting every unrelated or
+// legacy-tagged machine to it instead of HookOS.
+func TestScriptProviderFallback(t *testing.T) {
+	mac := mustParseMAC(t, "00:00:00:00:00:01")
+	coreos := &fakeProvider{name: "coreos"}
+	h := &Handler{Providers: []ScriptProvider{coreos}}
+
+	cases := []struct {
+		name     string
+		osieKind string
+		want     string
+	}{
+		{name: "legacy hardware with no OSIEKind", osieKind: "", want: hookOSProviderName},
+		{name: "explicitly tagged hookos", osieKind: "hookos", want: hookOSProviderName},
+		{name: "tagged for the configured provider", osieKind: "coreos", want: "coreos"},
+		{name: "tagged for an unconfigured provider", osieKind: "unknown-kind", want: hookOSProviderName},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hw := &fakeDiscoverer{mac: mac, hardware: &fakeHardware{osieKind: c.osieKind}}
+			got := h.scriptProvider(hw, mac).Name()
+			if got != c.want {
+				t.Fatalf("scriptProvider() = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+// TestScriptProviderDefaultProviderKind checks that DefaultProviderKind is consulted
+// before falling back to HookOS, and that an unresolvable DefaultProviderKind still
+// falls back to HookOS rather than an arbitrary configured provider.
+func TestScriptProviderDefaultProviderKind(t *testing.T) {
+	mac := mustParseMAC(t, "00:00:00:00:00:02")
+	coreos := &fakeProvider{name: "coreos"}
+	hw := &fakeDiscoverer{mac: mac, hardware: &fakeHardware{osieKind: ""}}
+
+	h := &Handler{Providers: []ScriptProvider{coreos}, DefaultProviderKind: "coreos"}
+	if got := h.scriptProvider(hw, mac).Name(); got != "coreos" {
+		t.Fatalf("scriptProvider() = %q, want %q", got, "coreos")
+	}
+
+	h = &Handler{Providers: []ScriptProvider{coreos}, DefaultProviderKind: "does-not-exist"}
+	if got := h.scriptProvider(hw, mac).Name(); got != hookOSProviderName {
+		t.Fatalf("scriptProvider() = %q, want %q", got, hookOSProviderName)
+	}
+}
+
+func TestCustomScriptSignedChain(t *testing.T) {
+	mac := mustParseMAC(t, "00:00:00:00:00:03")
+	hw := &fakeDiscoverer{mac: mac, hardware: &fakeHardware{ipxeURL: "http://example.com/chain.ipxe"}}
+
+	t.Run("unsigned by default", func(t *testing.T) {
+		h := &Handler{}
+		s, err := h.customScript(context.Background(), hw, "10.0.0.1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if strings.Contains(s, "imgtrust") || strings.Contains(s, "imgverify") {
+			t.Fatalf("expected an unsigned chain, got:\n%s", s)
+		}
+		if !strings.Contains(s, "chain http://example.com/chain.ipxe") {
+			t.Fatalf("expected a plain chain directive, got:\n%s", s)
+		}
+	})
+
+	t.Run("signs when a cert URL is configured", func(t *testing.T) {
+		h := &Handler{TrustedSigningCertURL: "http://example.com/cert.pem"}
+		s, err := h.customScript(context.Background(), hw, "10.0.0.1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(s, "imgtrust --permanent http://example.com/cert.pem") {
+			t.Fatalf("expected an imgtrust directive, got:\n%s", s)
+		}
+		if !strings.Contains(s, "imgverify custom.ipxe http://example.com/chain.ipxe.sig") {
+			t.Fatalf("expected an imgverify directive, got:\n%s", s)
+		}
+	})
+
+	t.Run("fails closed when required but unconfigured", func(t *testing.T) {
+		h := &Handler{RequireSignedChain: true}
+		if _, err := h.customScript(context.Background(), hw, "10.0.0.1"); err == nil {
+			t.Fatal("expected an error when RequireSignedChain is set without a cert URL")
+		}
+	})
+
+	t.Run("invalid trusted signing cert URL", func(t *testing.T) {
+		h := &Handler{TrustedSigningCertURL: "://not-a-url"}
+		if _, err := h.customScript(context.Background(), hw, "10.0.0.1"); err == nil {
+			t.Fatal("expected an error for an invalid trusted signing cert URL")
+		}
+	})
+}
+
+func TestCustomScriptTemplating(t *testing.T) {
+	mac := mustParseMAC(t, "aa:bb:cc:dd:ee:ff")
+	hw := &fakeDiscoverer{
+		mac: mac,
+		hardware: &fakeHardware{
+			ipxeScript: `mac={{mac "-"}} hex={{hex "ab"}} default={{default "fallback" ""}} rack={{V "rack"}} missing={{V "nope"}}`,
+			metadata:   map[string]string{"rack": "r1"},
+		},
+	}
+
+	h := &Handler{}
+	s, err := h.customScript(context.Background(), hw, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "mac=aa-bb-cc-dd-ee-ff hex=6162 default=fallback rack=r1 missing="
+	if !strings.Contains(s, want) {
+		t.Fatalf("expected rendered script to contain %q, got:\n%s", want, s)
+	}
+}
+
+func TestCustomScriptTemplatingVars(t *testing.T) {
+	mac := mustParseMAC(t, "00:11:22:33:44:55")
+	hw := &fakeDiscoverer{
+		mac: mac,
+		hardware: &fakeHardware{
+			ipxeScript: `mac={{.MAC}} arch={{.Arch}} facility={{.Facility}} instance={{.InstanceID}} vlan={{.VLANID}} client={{.ClientIP}} host={{.ServerHost}}`,
+			arch:       "aarch64",
+			facility:   "ewr1",
+			vlanID:     "200",
+		},
+		instance: &client.Instance{ID: "instance-1"},
+	}
+
+	ctx := contextWithServerHost(context.Background(), "boots.example.com")
+	h := &Handler{}
+	s, err := h.customScript(ctx, hw, "10.0.0.9")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "mac=00:11:22:33:44:55 arch=aarch64 facility=ewr1 instance=instance-1 vlan=200 client=10.0.0.9 host=boots.example.com"
+	if !strings.Contains(s, want) {
+		t.Fatalf("expected rendered script to contain %q, got:\n%s", want, s)
+	}
+}
+
+func TestCustomScriptDisableTemplating(t *testing.T) {
+	mac := mustParseMAC(t, "aa:bb:cc:dd:ee:ff")
+	hw := &fakeDiscoverer{mac: mac, hardware: &fakeHardware{ipxeScript: `{{.NotARealField}}`}}
+
+	h := &Handler{DisableCustomScriptTemplating: true}
+	s, err := h.customScript(context.Background(), hw, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(s, "{{.NotARealField}}") {
+		t.Fatalf("expected the script to pass through verbatim, got:\n%s", s)
+	}
+}
+
+func TestCustomScriptTemplateParseError(t *testing.T) {
+	mac := mustParseMAC(t, "aa:bb:cc:dd:ee:ff")
+	hw := &fakeDiscoverer{mac: mac, hardware: &fakeHardware{ipxeScript: `{{.Unclosed`}}
+
+	h := &Handler{}
+	if _, err := h.customScript(context.Background(), hw, "10.0.0.1"); err == nil {
+		t.Fatal("expected an error for invalid template syntax")
+	}
+}
+
+func TestCustomScriptTemplateExecError(t *testing.T) {
+	mac := mustParseMAC(t, "aa:bb:cc:dd:ee:ff")
+	hw := &fakeDiscoverer{mac: mac, hardware: &fakeHardware{ipxeScript: `{{.MAC.NoSuchField}}`}}
+
+	h := &Handler{}
+	if _, err := h.customScript(context.Background(), hw, "10.0.0.1"); err == nil {
+		t.Fatal("expected an error for a template execution failure")
+	}
+}
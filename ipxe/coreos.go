@@ -0,0 +1,109 @@
+package ipxe
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/tinkerbell/boots/client"
+)
+
+// CoreOS holds the fields used to render a CoreOS/Flatcar iPXE boot script.
+type CoreOS struct {
+	KernelURL string
+	InitrdURL string
+	ConfigURL string
+}
+
+// CoreOSScript is the iPXE script for chainloading into CoreOS/Flatcar. It sets
+// coreos.first_boot=1 and points coreos.config.url at the machine's rendered
+// Ignition/cloud-config document.
+const CoreOSScript = `#!ipxe
+
+kernel {{.KernelURL}} coreos.config.url={{.ConfigURL}} coreos.first_boot=1
+initrd {{.InitrdURL}}
+
+boot
+`
+
+// CoreOSScriptHTTPBoot renders the same kernel/initrd/cmdline configuration as
+// CoreOSScript but without the iPXE-only directives ("#!ipxe", "boot"), for UEFI HTTP
+// Boot clients that fetch and interpret this script directly.
+const CoreOSScriptHTTPBoot = `linux {{.KernelURL}} coreos.config.url={{.ConfigURL}} coreos.first_boot=1
+initrd {{.InitrdURL}}
+`
+
+// CoreOSProvider is a ScriptProvider that boots machines into CoreOS or Flatcar.
+type CoreOSProvider struct {
+	// KernelURL and InitrdURL are the full URLs to the CoreOS/Flatcar kernel and initrd.
+	KernelURL string
+	InitrdURL string
+	// ConfigURLTemplate is executed as a Go text/template, with the machine's MAC
+	// available, to build the coreos.config.url kernel param, e.g.
+	// "https://configs.example.com/{{.MAC}}.ign".
+	ConfigURLTemplate string
+}
+
+func (p *CoreOSProvider) Name() string { return "coreos" }
+
+func (p *CoreOSProvider) Default(_ context.Context, hw client.Discoverer, ip string) ([]byte, error) {
+	mac := hw.GetMAC(net.ParseIP(ip))
+	configURL, err := renderCoreOSConfigURL(p.ConfigURLTemplate, mac)
+	if err != nil {
+		return nil, errors.Wrap(err, "rendering coreos.config.url")
+	}
+
+	c := CoreOS{
+		KernelURL: p.KernelURL,
+		InitrdURL: p.InitrdURL,
+		ConfigURL: configURL,
+	}
+
+	s, err := GenerateTemplate(c, CoreOSScript)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(s), nil
+}
+
+func (p *CoreOSProvider) Custom(_ context.Context, _ client.Discoverer, _ string) ([]byte, error) {
+	return nil, errors.New("custom scripts are not supported by the coreos provider")
+}
+
+func (p *CoreOSProvider) HTTPBoot(_ context.Context, hw client.Discoverer, ip string) ([]byte, error) {
+	mac := hw.GetMAC(net.ParseIP(ip))
+	configURL, err := renderCoreOSConfigURL(p.ConfigURLTemplate, mac)
+	if err != nil {
+		return nil, errors.Wrap(err, "rendering coreos.config.url")
+	}
+
+	c := CoreOS{
+		KernelURL: p.KernelURL,
+		InitrdURL: p.InitrdURL,
+		ConfigURL: configURL,
+	}
+
+	s, err := GenerateTemplate(c, CoreOSScriptHTTPBoot)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(s), nil
+}
+
+func renderCoreOSConfigURL(tmpl string, mac net.HardwareAddr) (string, error) {
+	t, err := template.New("coreos-config-url").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, struct{ MAC string }{MAC: mac.String()}); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
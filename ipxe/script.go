@@ -0,0 +1,106 @@
+package ipxe
+
+import (
+	"bytes"
+	"net/url"
+	"text/template"
+)
+
+// Hook holds the fields used to render the default (HookOS) iPXE script for a machine.
+type Hook struct {
+	Arch                  string
+	Console               string
+	DownloadURL           string
+	ExtraKernelParams     []string
+	Facility              string
+	HWAddr                string
+	SyslogHost            string
+	TinkerbellTLS         bool
+	TinkerbellInsecureTLS bool
+	TinkGRPCAuthority     string
+	TraceID               string
+	VLANID                string
+	WorkerID              string
+}
+
+// Custom holds the fields used to render a custom iPXE script: either a chainload URL
+// or a verbatim operator-supplied script.
+type Custom struct {
+	Chain  *url.URL
+	Script string
+	// TrustedSigningCertURL, when set, causes Chain to be fetched, verified against the
+	// signature at "<Chain>.sig" using this cert, and only then chained to.
+	TrustedSigningCertURL *url.URL
+}
+
+// HookScript is the default iPXE script template for booting into HookOS.
+const HookScript = `#!ipxe
+
+set arch {{.Arch}}
+set download-url {{.DownloadURL}}
+
+kernel ${download-url}/vmlinuz-${arch} \
+facility={{.Facility}} \
+syslog_host={{.SyslogHost}} \
+grpc_authority={{.TinkGRPCAuthority}} \
+tinkerbell_tls={{.TinkerbellTLS}} \
+{{if .TinkerbellInsecureTLS}}tinkerbell_insecure_tls=1 \
+{{end}}worker_id={{.WorkerID}} \
+hw_addr={{.HWAddr}} \
+vlan_id={{.VLANID}} \
+{{if .TraceID}}trace_id={{.TraceID}} \
+{{end}}{{range .ExtraKernelParams}}{{.}} \
+{{end}}console={{.Console}} \
+modules=loop,squashfs,sd-mod,usb-storage
+initrd ${download-url}/initramfs-${arch}
+
+boot
+`
+
+// HookScriptHTTPBoot renders the HookOS boot configuration for UEFI HTTP Boot clients.
+// Unlike HookScript, it contains none of the iPXE-only directives ("#!ipxe", "set",
+// "kernel", "boot"); it emits "linux" and "initrd" lines instead, since these clients
+// fetch and interpret this script directly rather than chainloading into iPXE.
+const HookScriptHTTPBoot = `linux {{.DownloadURL}}/vmlinuz-{{.Arch}} \
+facility={{.Facility}} \
+syslog_host={{.SyslogHost}} \
+grpc_authority={{.TinkGRPCAuthority}} \
+tinkerbell_tls={{.TinkerbellTLS}} \
+{{if .TinkerbellInsecureTLS}}tinkerbell_insecure_tls=1 \
+{{end}}worker_id={{.WorkerID}} \
+hw_addr={{.HWAddr}} \
+vlan_id={{.VLANID}} \
+{{if .TraceID}}trace_id={{.TraceID}} \
+{{end}}{{range .ExtraKernelParams}}{{.}} \
+{{end}}console={{.Console}} \
+modules=loop,squashfs,sd-mod,usb-storage
+initrd {{.DownloadURL}}/initramfs-{{.Arch}}
+`
+
+// CustomScript renders an operator-provided custom iPXE script: either a chain to a
+// remote URL (optionally signature-verified via TrustedSigningCertURL) or a verbatim
+// script.
+const CustomScript = `#!ipxe
+
+{{if .Chain}}{{if .TrustedSigningCertURL}}imgtrust --permanent {{.TrustedSigningCertURL}}
+imgfetch --name custom.ipxe {{.Chain}}
+imgverify custom.ipxe {{.Chain}}.sig
+chain custom.ipxe
+{{else}}chain {{.Chain}}
+{{end}}{{else}}{{.Script}}
+{{end}}`
+
+// GenerateTemplate executes tmpl against data and returns the rendered script.
+func GenerateTemplate(data interface{}, tmpl string) (string, error) {
+	t, err := template.New("ipxe-script").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}